@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/gob"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CacheRecord is the last-seen certificate state persisted for a domain
+// between runs.
+type CacheRecord struct {
+	Fingerprint string
+	NotAfter    time.Time
+	Issuer      string
+	CheckedAt   time.Time
+}
+
+// Cache stores the last-seen CacheRecord for a domain so that changes can
+// be detected between runs.
+type Cache interface {
+	Get(ctx context.Context, domain string) (*CacheRecord, error)
+	Put(ctx context.Context, domain string, record *CacheRecord) error
+	Delete(ctx context.Context, domain string) error
+}
+
+// DirCache is a Cache that stores one gob-encoded file per domain under a
+// directory, modeled on autocert's DirCache.
+type DirCache string
+
+// Get returns the cached record for domain, or an error (including
+// os.ErrNotExist) if there isn't one.
+func (d DirCache) Get(ctx context.Context, domain string) (*CacheRecord, error) {
+	data, err := os.ReadFile(d.path(domain))
+	if err != nil {
+		return nil, err
+	}
+
+	var record CacheRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Put persists record for domain, creating the cache directory if needed.
+// Files are written 0600 since they're meaningless to anyone but the user
+// running expirybot.
+func (d DirCache) Put(ctx context.Context, domain string, record *CacheRecord) error {
+	if err := os.MkdirAll(string(d), 0700); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return err
+	}
+
+	return os.WriteFile(d.path(domain), buf.Bytes(), 0600)
+}
+
+// Delete removes the cached record for domain, if any.
+func (d DirCache) Delete(ctx context.Context, domain string) error {
+	err := os.Remove(d.path(domain))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path returns the cache file path for domain.
+func (d DirCache) path(domain string) string {
+	return filepath.Join(string(d), domain+".gob")
+}
+
+// getXDGCacheDir returns the default expirybot cache directory, following
+// the XDG Base Directory Specification.
+func getXDGCacheDir() string {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		cacheHome = filepath.Join(homeDir, ".cache")
+	}
+
+	return filepath.Join(cacheHome, appName)
+}
+
+// fingerprintOf returns a hex-encoded SHA-256 fingerprint of cert's raw DER
+// bytes, used to detect certificate rotation between runs.
+func fingerprintOf(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffCacheRecord compares a freshly fetched cert against a previously
+// cached record and returns a human-readable event for each notable
+// change: the fingerprint changing (the certificate was rotated), the
+// issuer changing, or NotAfter moving backwards. A nil cached record
+// (no prior check) produces no events.
+func diffCacheRecord(cached *CacheRecord, cert *x509.Certificate) []string {
+	if cached == nil {
+		return nil
+	}
+
+	var events []string
+
+	if fingerprint := fingerprintOf(cert); cached.Fingerprint != "" && cached.Fingerprint != fingerprint {
+		events = append(events, "certificate rotated")
+	}
+
+	if cached.Issuer != "" && cached.Issuer != cert.Issuer.CommonName {
+		events = append(events, "issuer changed")
+	}
+
+	if !cached.NotAfter.IsZero() && cert.NotAfter.Before(cached.NotAfter) {
+		events = append(events, "NotAfter moved backwards")
+	}
+
+	return events
+}
+
+// recordCert loads any previously cached record for domain, diffs it
+// against cert, stores cert's new state, and returns the change events
+// found (if any). Cache errors other than "not found" are swallowed: a
+// broken cache should never fail the underlying certificate check.
+func recordCert(ctx context.Context, cache Cache, domain string, cert *x509.Certificate) []string {
+	cached, _ := cache.Get(ctx, domain)
+	events := diffCacheRecord(cached, cert)
+
+	cache.Put(ctx, domain, &CacheRecord{
+		Fingerprint: fingerprintOf(cert),
+		NotAfter:    cert.NotAfter,
+		Issuer:      cert.Issuer.CommonName,
+		CheckedAt:   time.Now(),
+	})
+
+	return events
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// crawlEdgeKind describes why two domains in a CertGraph are connected.
+type crawlEdgeKind string
+
+const (
+	// edgeSAN connects a seed domain to another DNSName found in the same
+	// certificate's SubjectAltName extension.
+	edgeSAN crawlEdgeKind = "san"
+
+	// edgeSharedCert connects a domain to another domain that a CT log
+	// search reports as sharing a certificate with it.
+	edgeSharedCert crawlEdgeKind = "shared-cert"
+)
+
+// crawlEdge is one link discovered while crawling.
+type crawlEdge struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Kind crawlEdgeKind `json:"kind"`
+}
+
+// CertGraph is the result of a crawl: the domains discovered and the
+// relationships between them.
+type CertGraph struct {
+	Nodes []string    `json:"nodes"`
+	Edges []crawlEdge `json:"edges"`
+}
+
+// crawlOptions configures a crawl run.
+type crawlOptions struct {
+	Depth    int
+	QueryCT  bool
+	CTLogURL string // e.g. https://crt.sh/?q=%s&output=json
+}
+
+// runCrawl drives the -crawl subcommand: it crawls from seed out to depth
+// hops, prints the discovered domains, and optionally writes the graph to
+// graphOutPath in graphFormat ("json" or "dot").
+func runCrawl(seed string, depth int, queryCT bool, graphOutPath, graphFormat string) {
+	opts := crawlOptions{Depth: depth, QueryCT: queryCT}
+
+	graph := crawlCertGraph(seed, opts)
+
+	fmt.Printf("Discovered %d domain(s) from %s:\n", len(graph.Nodes), seed)
+	for _, node := range graph.Nodes {
+		fmt.Printf("  %s\n", node)
+	}
+
+	if graphOutPath != "" {
+		if err := writeGraph(graphOutPath, graphFormat, graph); err != nil {
+			fmt.Printf("Error writing graph: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Graph written to %s\n", graphOutPath)
+	}
+}
+
+// crawlCertGraph seeds a breadth-first crawl from seed, following SAN
+// entries (and, optionally, CT log search results) out to opts.Depth hops,
+// and returns the resulting graph. This turns expirybot from a static-list
+// checker into a discovery tool for auditing an org's certificate
+// footprint, in the spirit of the CertGraph tool.
+func crawlCertGraph(seed string, opts crawlOptions) *CertGraph {
+	graph := &CertGraph{}
+	visited := map[string]bool{}
+	type queueItem struct {
+		domain string
+		depth  int
+	}
+	queue := []queueItem{{domain: seed, depth: 0}}
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+
+		if visited[item.domain] {
+			continue
+		}
+		visited[item.domain] = true
+		graph.Nodes = append(graph.Nodes, item.domain)
+
+		if item.depth >= opts.Depth {
+			continue
+		}
+
+		sans, err := fetchDNSNames(item.domain)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "crawl: %s - could not fetch certificate: %v\n", item.domain, err)
+			continue
+		}
+
+		sanNames := map[string]bool{}
+		for _, san := range sans {
+			if san != item.domain {
+				sanNames[san] = true
+			}
+		}
+
+		ctNames := map[string]bool{}
+		if opts.QueryCT {
+			ctDomains, err := queryCTLog(opts.CTLogURL, item.domain)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "crawl: %s - CT log query failed: %v\n", item.domain, err)
+			}
+			for _, d := range ctDomains {
+				if d != item.domain && !sanNames[d] {
+					ctNames[d] = true
+				}
+			}
+		}
+
+		// A name can be discovered both ways; sanNames takes priority since
+		// it reflects the same certificate rather than a CT log's report of
+		// a possibly different one.
+		for d := range sanNames {
+			graph.Edges = append(graph.Edges, crawlEdge{From: item.domain, To: d, Kind: edgeSAN})
+			if !visited[d] {
+				queue = append(queue, queueItem{domain: d, depth: item.depth + 1})
+			}
+		}
+		for d := range ctNames {
+			graph.Edges = append(graph.Edges, crawlEdge{From: item.domain, To: d, Kind: edgeSharedCert})
+			if !visited[d] {
+				queue = append(queue, queueItem{domain: d, depth: item.depth + 1})
+			}
+		}
+	}
+
+	return graph
+}
+
+// fetchDNSNames retrieves a domain's leaf certificate over plain TLS and
+// returns the DNSNames listed in its SubjectAltName extension.
+func fetchDNSNames(domain string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{Timeout: checkTimeout}
+
+	fetched, err := (plainTLSGetter{}).GetCertificates(ctx, dialer, domain, defaultPortForProtocol(defaultProtocol))
+	if err != nil {
+		return nil, err
+	}
+	if len(fetched.Certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+
+	return fetched.Certs[0].DNSNames, nil
+}
+
+// crtShURL is the default CT log search endpoint, queried for certificates
+// sharing a SAN with the domain being crawled.
+const crtShURL = "https://crt.sh/?q=%s&output=json"
+
+// crtShEntry is the subset of crt.sh's JSON response expirybot cares about.
+type crtShEntry struct {
+	NameValue string `json:"name_value"`
+}
+
+// queryCTLog looks up domain against a crt.sh-style CT log search endpoint
+// (urlTemplate, a printf template with a single %s for the query) and
+// returns the distinct DNS names found across all matching certificates.
+func queryCTLog(urlTemplate, domain string) ([]string, error) {
+	if urlTemplate == "" {
+		urlTemplate = crtShURL
+	}
+
+	url := fmt.Sprintf(urlTemplate, domain)
+
+	client := &http.Client{Timeout: checkTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var entries []crtShEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, entry := range entries {
+		for _, name := range strings.Split(entry.NameValue, "\n") {
+			name = strings.TrimSpace(strings.TrimPrefix(name, "*."))
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// writeGraph writes graph to path in either "json" or "dot" (GraphViz)
+// format, inferred from format.
+func writeGraph(path, format string, graph *CertGraph) error {
+	var data []byte
+	var err error
+
+	switch format {
+	case "dot":
+		data = []byte(graphToDOT(graph))
+	default:
+		data, err = json.MarshalIndent(graph, "", "  ")
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// graphToDOT renders graph as a GraphViz DOT document.
+func graphToDOT(graph *CertGraph) string {
+	var b strings.Builder
+	b.WriteString("digraph expirybot {\n")
+	for _, node := range graph.Nodes {
+		fmt.Fprintf(&b, "  %q;\n", node)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", edge.From, edge.To, edge.Kind)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
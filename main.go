@@ -3,7 +3,6 @@ package main
 import (
 	"bufio"
 	"context"
-	"crypto/tls"
 	"crypto/x509"
 	"flag"
 	"fmt"
@@ -34,6 +33,21 @@ func main() {
 	// Define command line flags
 	filePtr := flag.String("file", "", "Path to domains file (overrides default config file)")
 	addDomainPtr := flag.String("add", "", "Add a domain to check (format: domain.com[,threshold])")
+	crawlPtr := flag.String("crawl", "", "Seed domain to crawl for related domains via SAN/CT discovery")
+	depthPtr := flag.Int("depth", 1, "Maximum crawl depth (used with -crawl)")
+	ctPtr := flag.Bool("ct", false, "Also query a CT log search endpoint while crawling (used with -crawl)")
+	graphOutPtr := flag.String("graph-out", "", "Write the crawl graph to this file (used with -crawl)")
+	graphFormatPtr := flag.String("graph-format", "json", "Crawl graph output format: json or dot (used with -crawl)")
+	formatPtr := flag.String("format", "text", "Result output format: text, json, or prometheus")
+	allPtr := flag.Bool("all", false, "Report on every domain, not just those within their threshold")
+	timeoutPtr := flag.Duration("timeout", checkTimeout, "Timeout for a single DNS+TLS check attempt")
+	retryTimeoutPtr := flag.Duration("retry-timeout", 0, "Keep retrying a failing domain until this much time has elapsed (0 disables retries)")
+	sleepPtr := flag.Duration("sleep", 2*time.Second, "Time to sleep between retry attempts")
+	notifyConfigPtr := flag.String("notify-config", getXDGNotifyConfigFilePath(), "Path to the notifier config file")
+	ocspPtr := flag.Bool("ocsp", false, "Check certificate revocation via OCSP (requires outbound HTTP)")
+	crlPtr := flag.Bool("crl", false, "Check certificate revocation via CRL if OCSP is unavailable (requires outbound HTTP)")
+	cacheDirPtr := flag.String("cache-dir", getXDGCacheDir(), "Directory to cache previous check results in, for change detection")
+	noCachePtr := flag.Bool("no-cache", false, "Disable the on-disk result cache")
 
 	// Parse command line flags
 	flag.Parse()
@@ -44,6 +58,12 @@ func main() {
 		return
 	}
 
+	// Handle crawl flag
+	if *crawlPtr != "" {
+		runCrawl(*crawlPtr, *depthPtr, *ctPtr, *graphOutPtr, *graphFormatPtr)
+		return
+	}
+
 	// Get the domains file path
 	var domainsFilePath string
 	if *filePtr != "" {
@@ -73,31 +93,53 @@ func main() {
 	}
 
 	// Check domains in parallel
-	checkDomainsParallel(domains, defaultThreshold)
+	opts := checkOptions{
+		Timeout:      *timeoutPtr,
+		RetryTimeout: *retryTimeoutPtr,
+		Sleep:        *sleepPtr,
+		CheckOCSP:    *ocspPtr,
+		CheckCRL:     *crlPtr,
+	}
+	if !*noCachePtr && *cacheDirPtr != "" {
+		opts.Cache = DirCache(*cacheDirPtr)
+	}
+	results := checkDomainsParallel(domains, defaultThreshold, opts)
+
+	// Report the results in the requested format
+	printResults(results, *formatPtr, *allPtr)
+
+	// Fan expiring/failed certs out to any configured notifiers
+	if _, err := os.Stat(*notifyConfigPtr); err == nil {
+		notifiers, err := loadNotifiers(*notifyConfigPtr)
+		if err != nil {
+			fmt.Printf("Error loading notifier config: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		defer cancel()
+
+		if err := notifyAll(ctx, notifiers, results); err != nil {
+			fmt.Printf("Error sending notifications: %v\n", err)
+		}
+	}
 }
 
-// Domain represents a domain with its custom threshold
+// Domain represents a domain with its custom threshold, plus the protocol
+// and port to use when fetching its certificate. Timeout, if non-zero,
+// overrides the run's default check timeout for this domain only.
 type Domain struct {
 	Name      string
+	Port      int
+	Protocol  string
 	Threshold int
+	Timeout   time.Duration
 }
 
 // addDomain adds a domain to the configuration file
 func addDomain(domainInput string) {
-	parts := strings.Split(domainInput, ",")
-
-	domain := parts[0]
-	threshold := defaultThreshold
-
-	// Check if threshold is provided
-	if len(parts) > 1 {
-		var err error
-		threshold, err = strconv.Atoi(parts[1])
-		if err != nil {
-			fmt.Printf("Invalid threshold value: %s. Using default: %d days\n", parts[1], defaultThreshold)
-			threshold = defaultThreshold
-		}
-	}
+	domain := parseDomainLine(domainInput)
+	threshold := domain.Threshold
 
 	// Get config file path
 	configPath := getXDGConfigFilePath()
@@ -118,10 +160,12 @@ func addDomain(domainInput string) {
 
 		// Check if domain already exists
 		for i, d := range domains {
-			if d.Name == domain {
-				// Update threshold
+			if d.Name == domain.Name {
+				// Update threshold and protocol/port
 				domains[i].Threshold = threshold
-				fmt.Printf("Updated domain %s with threshold %d days\n", domain, threshold)
+				domains[i].Protocol = domain.Protocol
+				domains[i].Port = domain.Port
+				fmt.Printf("Updated domain %s with threshold %d days\n", domain.Name, threshold)
 
 				// Write updated domains to file
 				writeDomainsToFile(configPath, domains)
@@ -131,12 +175,12 @@ func addDomain(domainInput string) {
 	}
 
 	// Add new domain
-	domains = append(domains, Domain{Name: domain, Threshold: threshold})
+	domains = append(domains, domain)
 
 	// Write domains to file
 	writeDomainsToFile(configPath, domains)
 
-	fmt.Printf("Added domain %s with threshold %d days\n", domain, threshold)
+	fmt.Printf("Added domain %s with threshold %d days\n", domain.Name, threshold)
 }
 
 // writeDomainsToFile writes domains to the configuration file
@@ -149,8 +193,31 @@ func writeDomainsToFile(filePath string, domains []Domain) error {
 
 	writer := bufio.NewWriter(file)
 	for _, domain := range domains {
-		_, err := writer.WriteString(fmt.Sprintf("%s,%d\n", domain.Name, domain.Threshold))
-		if err != nil {
+		protocol := domain.Protocol
+		if protocol == "" {
+			protocol = defaultProtocol
+		}
+
+		// Only qualify the host with ":port" when it differs from what
+		// parseDomainLine would default to for this protocol, so a plain
+		// "host,threshold" line round-trips unchanged.
+		host := domain.Name
+		if domain.Port != defaultPortForProtocol(protocol) {
+			host = fmt.Sprintf("%s:%d", domain.Name, domain.Port)
+		}
+
+		var line string
+		if protocol != defaultProtocol {
+			line = fmt.Sprintf("%s,%s,%d", host, protocol, domain.Threshold)
+		} else {
+			line = fmt.Sprintf("%s,%d", host, domain.Threshold)
+		}
+
+		if domain.Timeout > 0 {
+			line += fmt.Sprintf(",timeout=%s", domain.Timeout)
+		}
+
+		if _, err := writer.WriteString(line + "\n"); err != nil {
 			return err
 		}
 	}
@@ -178,7 +245,9 @@ func getXDGConfigFilePath() string {
 	return filepath.Join(appConfigDir, appName+".conf")
 }
 
-// readDomainsFromFile reads domains from a file with format "domain,threshold"
+// readDomainsFromFile reads domains from a file, one entry per line, in the
+// format "host[:port][,protocol][,threshold]". See parseDomainLine for the
+// full grammar, including the legacy "domain,threshold" shorthand.
 func readDomainsFromFile(filePath string) ([]Domain, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -195,21 +264,7 @@ func readDomainsFromFile(filePath string) ([]Domain, error) {
 			continue
 		}
 
-		parts := strings.Split(line, ",")
-		domain := parts[0]
-		threshold := defaultThreshold
-
-		// Parse threshold if provided
-		if len(parts) > 1 {
-			var err error
-			threshold, err = strconv.Atoi(parts[1])
-			if err != nil {
-				// Use default threshold if parsing fails
-				threshold = defaultThreshold
-			}
-		}
-
-		domains = append(domains, Domain{Name: domain, Threshold: threshold})
+		domains = append(domains, parseDomainLine(line))
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -219,11 +274,87 @@ func readDomainsFromFile(filePath string) ([]Domain, error) {
 	return domains, nil
 }
 
-// checkDomainsParallel checks multiple domains in parallel with a limit on concurrent checks
-func checkDomainsParallel(domains []Domain, defaultThreshold int) {
+// parseDomainLine parses a single config line into a Domain. The accepted
+// grammar is:
+//
+//	host[:port][,protocol][,threshold][,key=value...]
+//
+// Fields after the host may appear in any order: a bare integer sets the
+// threshold (for backwards compatibility with the legacy "domain,threshold"
+// format), a bare word sets the protocol, and a "key=value" pair sets a
+// per-domain option such as "timeout=5s". The protocol defaults to plain
+// TLS on :443.
+func parseDomainLine(line string) Domain {
+	parts := strings.Split(line, ",")
+
+	host, port := splitHostPort(parts[0])
+	d := Domain{Name: host, Port: port, Protocol: defaultProtocol, Threshold: defaultThreshold}
+
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+
+		if strings.Contains(part, "=") {
+			applyDomainOption(&d, part)
+			continue
+		}
+
+		if threshold, err := strconv.Atoi(part); err == nil {
+			d.Threshold = threshold
+			continue
+		}
+
+		d.Protocol = strings.ToLower(part)
+	}
+
+	if d.Port == 0 {
+		d.Port = defaultPortForProtocol(d.Protocol)
+	}
+
+	return d
+}
+
+// applyDomainOption applies a single "key=value" config field to d. Unknown
+// keys and unparseable values are ignored.
+func applyDomainOption(d *Domain, option string) {
+	key, value, found := strings.Cut(option, "=")
+	if !found {
+		return
+	}
+
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "timeout":
+		if dur, err := time.ParseDuration(strings.TrimSpace(value)); err == nil {
+			d.Timeout = dur
+		}
+	}
+}
+
+// splitHostPort splits "host" or "host:port" into its parts. If no port is
+// given, 0 is returned so the caller can fall back to a protocol default.
+func splitHostPort(hostPort string) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort, 0
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return host, 0
+	}
+
+	return host, port
+}
+
+// checkDomainsParallel checks multiple domains in parallel with a limit on
+// concurrent checks and returns one Result per domain, in no particular
+// order. Each domain is retried per opts until it succeeds or its retry
+// budget is exhausted - see checkDomainWithRetry.
+func checkDomainsParallel(domains []Domain, defaultThreshold int, opts checkOptions) []Result {
 	// Create a semaphore channel to limit concurrent goroutines
 	sem := make(chan struct{}, maxConcurrentChecks)
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make([]Result, 0, len(domains))
 
 	for _, domain := range domains {
 		// Use domain-specific threshold if available, otherwise use default
@@ -242,17 +373,23 @@ func checkDomainsParallel(domains []Domain, defaultThreshold int) {
 			sem <- struct{}{}
 			defer func() { <-sem }() // Release semaphore
 
-			checkDomain(domain.Name, threshold)
+			result := checkDomainWithRetry(domain, threshold, opts)
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
 		}(domain, threshold)
 	}
 
 	// Wait for all goroutines to complete
 	wg.Wait()
+
+	return results
 }
 
-// isDomainReachable checks if a domain is reachable via DNS lookup
-func isDomainReachable(domain string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+// isDomainReachable checks if a domain is reachable via DNS lookup within timeout
+func isDomainReachable(domain string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	resolver := net.Resolver{}
@@ -279,37 +416,40 @@ func checkCertificate(cert *x509.Certificate) (bool, int) {
 	return true, expiresInDays
 }
 
-// checkDomain checks if a domain is reachable and its SSL certificate validity
-func checkDomain(domain string, thresholdDays int) {
+// checkDomain performs a single check of domain's reachability and SSL
+// certificate validity within timeout, fetching the certificate over the
+// protocol configured for it (plain TLS by default, or a STARTTLS upgrade
+// for mail/directory/database protocols - see certGetterForProtocol), and
+// returns the outcome as a Result. Callers that want retries should use
+// checkDomainWithRetry instead.
+func checkDomain(domain Domain, thresholdDays int, timeout time.Duration, opts checkOptions) Result {
+	result := Result{Domain: domain.Name, Threshold: thresholdDays}
+
 	// Check if domain is reachable
-	if err := isDomainReachable(domain); err != nil {
-		fmt.Printf("[✗] %s - DNS lookup failed\n", domain)
-		return
+	if err := isDomainReachable(domain.Name, timeout); err != nil {
+		result.Error = "DNS lookup failed"
+		return result
 	}
 
-	// Create a connection with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
 	dialer := &net.Dialer{
-		Timeout: checkTimeout,
+		Timeout: timeout,
 	}
 
-	// Configure TLS connection
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,
-	}
+	getter := certGetterForProtocol(domain.Protocol)
 
-	// Check SSL certificate
-	conn, err := tls.DialWithDialer(dialer, "tcp", domain+":443", tlsConfig)
+	fetched, err := getter.GetCertificates(ctx, dialer, domain.Name, domain.Port)
 	if err != nil {
-		fmt.Printf("[✗] %s - SSL connection failed or cert expired [%s]\n", domain, err)
-		return
+		result.Error = fmt.Sprintf("SSL connection failed or cert expired [%s]", err)
+		return result
 	}
-	defer conn.Close()
 
-	// Get certificate details
-	certs := conn.ConnectionState().PeerCertificates
+	certs := fetched.Certs
 	if len(certs) == 0 {
-		fmt.Printf("[✗] %s - No certificates found\n", domain)
-		return
+		result.Error = "No certificates found"
+		return result
 	}
 
 	// Check primary certificate
@@ -317,12 +457,32 @@ func checkDomain(domain string, thresholdDays int) {
 	valid, daysRemaining := checkCertificate(cert)
 
 	if !valid {
-		fmt.Printf("[✗] %s - Certificate is not valid\n", domain)
-		return
+		result.Error = "Certificate is not valid"
+		return result
 	}
 
-	// Only print if certificate expires within threshold
-	if daysRemaining <= thresholdDays {
-		fmt.Printf("[✓] %s - Certificate expires in %d days\n", domain, daysRemaining)
+	if opts.CheckOCSP || opts.CheckCRL {
+		var issuer *x509.Certificate
+		if len(certs) > 1 {
+			issuer = certs[1]
+		}
+
+		result.Revocation = checkRevocation(ctx, cert, issuer, fetched.OCSPResponse, opts.CheckOCSP, opts.CheckCRL)
+		if result.Revocation == RevocationRevoked {
+			result.Error = "Certificate has been revoked"
+			return result
+		}
 	}
+
+	result.Valid = true
+	result.DaysRemaining = daysRemaining
+	result.NotAfter = cert.NotAfter
+	result.Issuer = cert.Issuer.CommonName
+	result.SANs = cert.DNSNames
+
+	if opts.Cache != nil {
+		result.CacheEvents = recordCert(ctx, opts.Cache, domain.Name, cert)
+	}
+
+	return result
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseDomainLineDefaults(t *testing.T) {
+	d := parseDomainLine("example.com")
+
+	if d.Name != "example.com" {
+		t.Errorf("Name = %q, want %q", d.Name, "example.com")
+	}
+	if d.Protocol != defaultProtocol {
+		t.Errorf("Protocol = %q, want %q", d.Protocol, defaultProtocol)
+	}
+	if d.Port != defaultPortForProtocol(defaultProtocol) {
+		t.Errorf("Port = %d, want %d", d.Port, defaultPortForProtocol(defaultProtocol))
+	}
+	if d.Threshold != defaultThreshold {
+		t.Errorf("Threshold = %d, want %d", d.Threshold, defaultThreshold)
+	}
+}
+
+func TestParseDomainLineLegacyShorthand(t *testing.T) {
+	d := parseDomainLine("example.com,30")
+
+	if d.Threshold != 30 {
+		t.Errorf("Threshold = %d, want 30", d.Threshold)
+	}
+	if d.Protocol != defaultProtocol {
+		t.Errorf("Protocol = %q, want %q", d.Protocol, defaultProtocol)
+	}
+}
+
+func TestParseDomainLineCustomPortAndProtocol(t *testing.T) {
+	d := parseDomainLine("mail.example.com:587,smtp,7")
+
+	if d.Name != "mail.example.com" {
+		t.Errorf("Name = %q, want %q", d.Name, "mail.example.com")
+	}
+	if d.Port != 587 {
+		t.Errorf("Port = %d, want 587", d.Port)
+	}
+	if d.Protocol != "smtp" {
+		t.Errorf("Protocol = %q, want %q", d.Protocol, "smtp")
+	}
+	if d.Threshold != 7 {
+		t.Errorf("Threshold = %d, want 7", d.Threshold)
+	}
+}
+
+func TestParseDomainLineFieldsAnyOrder(t *testing.T) {
+	d := parseDomainLine("example.com,7,timeout=5s")
+
+	if d.Threshold != 7 {
+		t.Errorf("Threshold = %d, want 7", d.Threshold)
+	}
+	if d.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", d.Timeout)
+	}
+}
+
+func TestParseDomainLineUnknownOptionIgnored(t *testing.T) {
+	d := parseDomainLine("example.com,bogus=nonsense,7")
+
+	if d.Threshold != 7 {
+		t.Errorf("Threshold = %d, want 7", d.Threshold)
+	}
+	if d.Timeout != 0 {
+		t.Errorf("Timeout = %v, want 0", d.Timeout)
+	}
+}
+
+func TestParseDomainLinePortWithoutProtocol(t *testing.T) {
+	// A custom port on its own, with no explicit protocol, should still
+	// resolve to the plain-TLS default protocol.
+	d := parseDomainLine("example.com:8443,14")
+
+	if d.Port != 8443 {
+		t.Errorf("Port = %d, want 8443", d.Port)
+	}
+	if d.Protocol != defaultProtocol {
+		t.Errorf("Protocol = %q, want %q", d.Protocol, defaultProtocol)
+	}
+}
+
+// writeDomainsToFile must preserve a custom port on a domain that otherwise
+// uses the default protocol; it previously only wrote the port when the
+// protocol was also non-default, silently reverting custom ports back to
+// the protocol default on the next -add/update.
+func TestWriteDomainsToFilePreservesCustomPortWithDefaultProtocol(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "domains.conf")
+
+	domains := []Domain{
+		{Name: "mydomain.com", Port: 8443, Protocol: defaultProtocol, Threshold: 14},
+	}
+
+	if err := writeDomainsToFile(path, domains); err != nil {
+		t.Fatalf("writeDomainsToFile: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	got := parseDomainLine(string(data[:len(data)-1])) // strip trailing newline
+	if got.Port != 8443 {
+		t.Errorf("round-tripped Port = %d, want 8443", got.Port)
+	}
+	if got.Protocol != defaultProtocol {
+		t.Errorf("round-tripped Protocol = %q, want %q", got.Protocol, defaultProtocol)
+	}
+}
+
+func TestWriteDomainsToFileOmitsDefaultPort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "domains.conf")
+
+	domains := []Domain{
+		{Name: "example.com", Port: defaultPortForProtocol(defaultProtocol), Protocol: defaultProtocol, Threshold: 14},
+	}
+
+	if err := writeDomainsToFile(path, domains); err != nil {
+		t.Fatalf("writeDomainsToFile: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	want := "example.com,14\n"
+	if string(data) != want {
+		t.Errorf("wrote %q, want %q", string(data), want)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// severity describes how urgently a Result should be escalated.
+type severity string
+
+const (
+	severityNone     severity = ""
+	severityWarning  severity = "warning"
+	severityCritical severity = "critical"
+)
+
+// getXDGNotifyConfigFilePath returns the default path to the notifier
+// config file, following the XDG Base Directory Specification like
+// getXDGConfigFilePath.
+func getXDGNotifyConfigFilePath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+
+	return filepath.Join(configHome, appName, appName+".toml")
+}
+
+// Notifier fans expiring or failed certificate results out to an external
+// channel (email, webhook, chat, ...).
+type Notifier interface {
+	Notify(ctx context.Context, results []Result) error
+}
+
+// thresholds holds the per-notifier warn/critical day counts read from
+// config; they decide which results a notifier is sent at all.
+type thresholds struct {
+	WarnDays     int
+	CriticalDays int
+}
+
+// severityOf classifies r against t: a failed check is always critical, an
+// expiry within CriticalDays is critical, within WarnDays is a warning, and
+// anything healthier is not reported.
+func (t thresholds) severityOf(r Result) severity {
+	if r.Error != "" {
+		return severityCritical
+	}
+	if r.DaysRemaining <= t.CriticalDays {
+		return severityCritical
+	}
+	if r.DaysRemaining <= t.WarnDays {
+		return severityWarning
+	}
+	return severityNone
+}
+
+// filter returns the subset of results that meet t's thresholds.
+func (t thresholds) filter(results []Result) []Result {
+	var out []Result
+	for _, r := range results {
+		if t.severityOf(r) != severityNone {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// notifyAll sends results to every configured notifier, continuing past
+// individual failures and returning them all joined together.
+func notifyAll(ctx context.Context, notifiers []Notifier, results []Result) error {
+	var errs []string
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, results); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("notifier errors: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// loadNotifiers reads a notifier config file and builds the Notifiers it
+// describes. See parseNotifierConfig for the file format.
+func loadNotifiers(path string) ([]Notifier, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, err := parseNotifierConfig(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifiers []Notifier
+	for _, entry := range entries {
+		notifier, err := buildNotifier(entry)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+
+	return notifiers, nil
+}
+
+// parseNotifierConfig parses expirybot's notifier config format, a small
+// TOML subset: repeated "[[notifier]]" array-of-tables, each a flat list of
+// "key = value" string/int fields. expirybot hand-rolls this rather than
+// pulling in a TOML library, matching the rest of its config parsing.
+func parseNotifierConfig(r *os.File) ([]map[string]string, error) {
+	var entries []map[string]string
+	var current map[string]string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if line == "[[notifier]]" {
+			current = map[string]string{}
+			entries = append(entries, current)
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		current[key] = value
+	}
+
+	return entries, scanner.Err()
+}
+
+// buildNotifier constructs the Notifier described by a parsed [[notifier]]
+// entry, dispatching on its "type" field.
+func buildNotifier(fields map[string]string) (Notifier, error) {
+	t := thresholds{WarnDays: 30, CriticalDays: 7}
+	if v, ok := fields["warn_days"]; ok {
+		if days, err := strconv.Atoi(v); err == nil {
+			t.WarnDays = days
+		}
+	}
+	if v, ok := fields["critical_days"]; ok {
+		if days, err := strconv.Atoi(v); err == nil {
+			t.CriticalDays = days
+		}
+	}
+
+	switch fields["type"] {
+	case "email":
+		port, _ := strconv.Atoi(fields["smtp_port"])
+		return &emailNotifier{
+			Host:       fields["smtp_host"],
+			Port:       port,
+			Username:   fields["smtp_username"],
+			Password:   fields["smtp_password"],
+			From:       fields["from"],
+			To:         fields["to"],
+			thresholds: t,
+		}, nil
+	case "webhook":
+		return &webhookNotifier{URL: fields["url"], thresholds: t}, nil
+	case "slack":
+		return &slackNotifier{WebhookURL: fields["webhook_url"], thresholds: t}, nil
+	case "gotify":
+		return &gotifyNotifier{URL: fields["url"], Token: fields["token"], thresholds: t}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type: %q", fields["type"])
+	}
+}
+
+// summarize renders results as a short multi-line message body shared by
+// every notifier backend.
+func summarize(results []Result) string {
+	var b strings.Builder
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(&b, "[✗] %s - %s\n", r.Domain, r.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "[!] %s - certificate expires in %d days\n", r.Domain, r.DaysRemaining)
+	}
+	return b.String()
+}
+
+// emailNotifier sends expiring/failed certs as a plain text email over
+// SMTP.
+type emailNotifier struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	From       string
+	To         string
+	thresholds thresholds
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, results []Result) error {
+	due := n.thresholds.filter(results)
+	if len(due) == 0 {
+		return nil
+	}
+
+	addr := fmt.Sprintf("%s:%d", n.Host, n.Port)
+	auth := smtp.PlainAuth("", n.Username, n.Password, n.Host)
+
+	body := fmt.Sprintf("Subject: %s certificate report\r\n\r\n%s", appName, summarize(due))
+	return smtp.SendMail(addr, auth, n.From, []string{n.To}, []byte(body))
+}
+
+// webhookNotifier POSTs expiring/failed certs as a JSON body to an
+// arbitrary HTTPS endpoint.
+type webhookNotifier struct {
+	URL        string
+	thresholds thresholds
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, results []Result) error {
+	due := n.thresholds.filter(results)
+	if len(due) == 0 {
+		return nil
+	}
+	return postJSON(ctx, n.URL, due)
+}
+
+// slackNotifier posts a plain-text summary to a Slack incoming webhook.
+type slackNotifier struct {
+	WebhookURL string
+	thresholds thresholds
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, results []Result) error {
+	due := n.thresholds.filter(results)
+	if len(due) == 0 {
+		return nil
+	}
+	return postJSON(ctx, n.WebhookURL, map[string]string{"text": summarize(due)})
+}
+
+// gotifyNotifier pushes a message to a Gotify server.
+type gotifyNotifier struct {
+	URL        string
+	Token      string
+	thresholds thresholds
+}
+
+func (n *gotifyNotifier) Notify(ctx context.Context, results []Result) error {
+	due := n.thresholds.filter(results)
+	if len(due) == 0 {
+		return nil
+	}
+
+	priority := 5
+	for _, r := range due {
+		if n.thresholds.severityOf(r) == severityCritical {
+			priority = 8
+			break
+		}
+	}
+
+	payload := map[string]interface{}{
+		"title":    fmt.Sprintf("%s certificate report", appName),
+		"message":  summarize(due),
+		"priority": priority,
+	}
+
+	return postJSON(ctx, strings.TrimRight(n.URL, "/")+"/message?token="+n.Token, payload)
+}
+
+// postJSON marshals body as JSON and POSTs it to url.
+func postJSON(ctx context.Context, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
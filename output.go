@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Result is the outcome of checking a single domain's certificate.
+type Result struct {
+	Domain        string           `json:"domain"`
+	Threshold     int              `json:"threshold"`
+	Valid         bool             `json:"valid"`
+	DaysRemaining int              `json:"days_remaining"`
+	NotAfter      time.Time        `json:"not_after"`
+	Issuer        string           `json:"issuer,omitempty"`
+	SANs          []string         `json:"sans,omitempty"`
+	Revocation    RevocationStatus `json:"revocation,omitempty"`
+	CacheEvents   []string         `json:"cache_events,omitempty"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// dueForReport reports whether r is worth surfacing on its own: it failed,
+// its certificate expires within its threshold, or the cache flagged
+// something about it worth a human's attention (e.g. a rotation or issuer
+// change) even though the current certificate is otherwise healthy.
+func (r Result) dueForReport() bool {
+	return r.Error != "" || r.DaysRemaining <= r.Threshold || len(r.CacheEvents) > 0
+}
+
+// printResults prints results in the requested format ("text", "json", or
+// "prometheus"). Unless all is true, "text" only reports domains that are
+// due for report (errored, or within their expiry threshold), matching
+// expirybot's original behavior.
+func printResults(results []Result, format string, all bool) {
+	switch format {
+	case "json":
+		printResultsJSON(results)
+	case "prometheus":
+		printResultsPrometheus(results)
+	default:
+		printResultsText(results, all)
+	}
+}
+
+// printResultsText prints results as human-readable [✓]/[✗] lines.
+func printResultsText(results []Result, all bool) {
+	for _, r := range results {
+		if !all && !r.dueForReport() {
+			continue
+		}
+
+		if r.Error != "" {
+			fmt.Printf("[✗] %s - %s\n", r.Domain, r.Error)
+			continue
+		}
+
+		fmt.Printf("[✓] %s - Certificate expires in %d days\n", r.Domain, r.DaysRemaining)
+		for _, event := range r.CacheEvents {
+			fmt.Printf("    ! %s\n", event)
+		}
+	}
+}
+
+// printResultsJSON prints results as a single JSON array, suitable for
+// piping into alerting pipelines.
+func printResultsJSON(results []Result) {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		fmt.Printf("Error formatting results as JSON: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// printResultsPrometheus prints results as Prometheus textfile-collector
+// metrics, for cron jobs that feed node_exporter.
+func printResultsPrometheus(results []Result) {
+	fmt.Println("# HELP ssl_cert_expiry_days Days remaining until the certificate expires.")
+	fmt.Println("# TYPE ssl_cert_expiry_days gauge")
+	for _, r := range results {
+		if r.Error != "" {
+			continue
+		}
+		fmt.Printf("ssl_cert_expiry_days{domain=%q} %d\n", r.Domain, r.DaysRemaining)
+	}
+
+	fmt.Println("# HELP ssl_cert_valid Whether the certificate check succeeded (1) or failed (0).")
+	fmt.Println("# TYPE ssl_cert_valid gauge")
+	for _, r := range results {
+		validValue := 0
+		if r.Valid {
+			validValue = 1
+		}
+		fmt.Printf("ssl_cert_valid{domain=%q} %d\n", r.Domain, validValue)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDueForReport(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Result
+		want bool
+	}{
+		{"healthy", Result{DaysRemaining: 90, Threshold: 14}, false},
+		{"within threshold", Result{DaysRemaining: 10, Threshold: 14}, true},
+		{"error", Result{Error: "dial failed"}, true},
+		{
+			"healthy but cache event",
+			Result{DaysRemaining: 90, Threshold: 14, CacheEvents: []string{"issuer changed"}},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.dueForReport(); got != tt.want {
+				t.Errorf("dueForReport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A certificate expiring today has DaysRemaining == 0, the Go zero value -
+// "days_remaining" must still appear in the JSON output so consumers doing
+// a key-presence or numeric comparison (e.g. jq '.days_remaining <= 7')
+// see 0, not a missing key.
+func TestResultJSONIncludesZeroDaysRemaining(t *testing.T) {
+	r := Result{Domain: "example.com", Threshold: 14, Valid: true, DaysRemaining: 0}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"days_remaining":0`) {
+		t.Errorf("JSON output missing days_remaining:0: %s", data)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "time"
+
+// checkOptions bundles the per-run timing knobs used when checking
+// domains: how long a single DNS+TLS attempt may take, how long to keep
+// retrying a failing domain before giving up, and how long to sleep
+// between retries.
+type checkOptions struct {
+	Timeout      time.Duration
+	RetryTimeout time.Duration
+	Sleep        time.Duration
+
+	// CheckOCSP and CheckCRL opt into revocation checking, which requires
+	// outbound HTTP requests beyond the certificate fetch itself.
+	CheckOCSP bool
+	CheckCRL  bool
+
+	// Cache, if set, is consulted and updated with each domain's latest
+	// certificate state so changes like rotation can be reported.
+	Cache Cache
+}
+
+// checkDomainWithRetry checks domain, retrying on failure until it
+// succeeds or opts.RetryTimeout has elapsed since the first attempt,
+// sleeping opts.Sleep between attempts. A zero RetryTimeout performs a
+// single attempt, matching expirybot's original behavior. domain's own
+// Timeout, if set, overrides opts.Timeout for every attempt.
+func checkDomainWithRetry(domain Domain, thresholdDays int, opts checkOptions) Result {
+	timeout := opts.Timeout
+	if domain.Timeout > 0 {
+		timeout = domain.Timeout
+	}
+
+	deadline := time.Now().Add(opts.RetryTimeout)
+
+	for {
+		result := checkDomain(domain, thresholdDays, timeout, opts)
+		if result.Error == "" || opts.RetryTimeout <= 0 || !time.Now().Before(deadline) {
+			return result
+		}
+
+		time.Sleep(opts.Sleep)
+	}
+}
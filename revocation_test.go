@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A leaf-only handshake (no issuer in the chain) is the norm for
+// self-signed and internal mail/DB certs; checkRevocation must not panic
+// when asked to run OCSP against one.
+func TestCheckRevocationNilIssuerDoesNotPanic(t *testing.T) {
+	leaf := &x509.Certificate{OCSPServer: []string{"http://ocsp.example.com"}}
+
+	status := checkRevocation(context.Background(), leaf, nil, nil, true, false)
+
+	if status != RevocationUnknown {
+		t.Errorf("expected RevocationUnknown with no issuer, got %v", status)
+	}
+}
+
+func TestFetchOCSPNilIssuer(t *testing.T) {
+	leaf := &x509.Certificate{OCSPServer: []string{"http://ocsp.example.com"}}
+
+	if _, err := fetchOCSP(context.Background(), leaf, nil); err == nil {
+		t.Error("expected an error when issuer is nil, got none")
+	}
+}
+
+func TestParseOCSPResponseNilIssuer(t *testing.T) {
+	leaf := &x509.Certificate{}
+
+	if _, err := parseOCSPResponse([]byte{0x01}, leaf, nil); err == nil {
+		t.Error("expected an error when issuer is nil, got none")
+	}
+}
+
+// newTestCA generates a minimal self-signed CA certificate and key, for
+// signing test CRLs.
+func newTestCA(t *testing.T, serial int64) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{byte(serial)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+
+	return cert, key
+}
+
+// serveCRL starts an HTTP test server returning der for any request.
+func serveCRL(t *testing.T, der []byte) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(der)
+	}))
+}
+
+// fetchCRL must reject a CRL that isn't signed by the certificate's actual
+// issuer. CRL distribution points are fetched over plain HTTP with no other
+// authentication, so a network-position attacker who can serve a CRL at
+// all could otherwise forge a clean (or a falsely revoked) result.
+func TestFetchCRLRejectsWrongSigner(t *testing.T) {
+	issuer, _ := newTestCA(t, 1)
+	attacker, attackerKey := newTestCA(t, 2)
+
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(42)}
+
+	crlTemplate := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: leaf.SerialNumber, RevocationTime: time.Now()},
+		},
+	}
+
+	// Signed by attacker, not the leaf's real issuer.
+	der, err := x509.CreateRevocationList(rand.Reader, crlTemplate, attacker, attackerKey)
+	if err != nil {
+		t.Fatalf("failed to create CRL: %v", err)
+	}
+
+	server := serveCRL(t, der)
+	defer server.Close()
+
+	status, err := fetchCRL(context.Background(), server.URL, leaf, issuer)
+	if err == nil {
+		t.Fatal("expected a signature verification error, got none")
+	}
+	if status != RevocationUnknown {
+		t.Errorf("status = %v, want RevocationUnknown", status)
+	}
+}
+
+// fetchCRL must accept a CRL correctly signed by the certificate's issuer
+// and report entries in it as revoked.
+func TestFetchCRLAcceptsCorrectSigner(t *testing.T) {
+	issuer, issuerKey := newTestCA(t, 1)
+
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(42)}
+
+	crlTemplate := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: leaf.SerialNumber, RevocationTime: time.Now()},
+		},
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, crlTemplate, issuer, issuerKey)
+	if err != nil {
+		t.Fatalf("failed to create CRL: %v", err)
+	}
+
+	server := serveCRL(t, der)
+	defer server.Close()
+
+	status, err := fetchCRL(context.Background(), server.URL, leaf, issuer)
+	if err != nil {
+		t.Fatalf("fetchCRL returned an error for a correctly-signed CRL: %v", err)
+	}
+	if status != RevocationRevoked {
+		t.Errorf("status = %v, want RevocationRevoked", status)
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// defaultProtocol is used for domain entries that don't specify one.
+const defaultProtocol = "tls"
+
+// CertFetchResult bundles the certificate chain obtained from a handshake
+// with any OCSP response stapled to the connection, so callers that want
+// revocation status don't need a second round trip.
+type CertFetchResult struct {
+	Certs        []*x509.Certificate
+	OCSPResponse []byte
+}
+
+// certGetter negotiates whatever handshake a protocol requires (a direct
+// TLS handshake, or a plaintext exchange followed by a STARTTLS upgrade)
+// and returns the peer certificate chain presented by the server.
+type certGetter interface {
+	GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error)
+}
+
+// certGetterForProtocol returns the certGetter registered for protocol,
+// falling back to plain TLS for an empty or unrecognized value.
+func certGetterForProtocol(protocol string) certGetter {
+	if getter, ok := certGetters[strings.ToLower(protocol)]; ok {
+		return getter
+	}
+	return plainTLSGetter{}
+}
+
+// defaultPortForProtocol returns the conventional port for protocol, used
+// when a config line doesn't specify one explicitly.
+func defaultPortForProtocol(protocol string) int {
+	if port, ok := defaultPorts[strings.ToLower(protocol)]; ok {
+		return port
+	}
+	return 443
+}
+
+var defaultPorts = map[string]int{
+	defaultProtocol: 443,
+	"smtp":          25,
+	"imap":          143,
+	"pop3":          110,
+	"ftp":           21,
+	"ldap":          389,
+	"postgres":      5432,
+	"mysql":         3306,
+}
+
+var certGetters = map[string]certGetter{
+	defaultProtocol: plainTLSGetter{},
+	"smtp":          smtpStartTLSGetter{},
+	"imap":          imapStartTLSGetter{},
+	"pop3":          pop3StartTLSGetter{},
+	"ftp":           ftpStartTLSGetter{},
+	"ldap":          ldapStartTLSGetter{},
+	"postgres":      postgresStartTLSGetter{},
+	"mysql":         mysqlStartTLSGetter{},
+}
+
+// dialPlain opens a plaintext TCP connection to host:port honoring ctx and
+// the dialer's timeout. If ctx carries a deadline, it's also applied to the
+// connection itself, so that the plaintext reads/writes STARTTLS
+// negotiation does afterwards (which don't take a context) still time out
+// instead of blocking forever on a server that accepts the connection but
+// never speaks.
+func dialPlain(ctx context.Context, dialer *net.Dialer, host string, port int) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// upgradeToTLS performs a client TLS handshake over an already-connected
+// plaintext conn (as left behind by a STARTTLS negotiation) and returns the
+// certificates the server presents.
+func upgradeToTLS(conn net.Conn, host string) (*CertFetchResult, error) {
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer tlsConn.Close()
+
+	state := tlsConn.ConnectionState()
+	return &CertFetchResult{Certs: state.PeerCertificates, OCSPResponse: state.OCSPResponse}, nil
+}
+
+// plainTLSGetter fetches certificates over a direct TLS connection, e.g.
+// HTTPS. This is expirybot's original behavior.
+type plainTLSGetter struct{}
+
+func (plainTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	tlsDialer := &tls.Dialer{
+		NetDialer: dialer,
+		Config:    &tls.Config{ServerName: host},
+	}
+
+	conn, err := tlsDialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	return &CertFetchResult{Certs: state.PeerCertificates, OCSPResponse: state.OCSPResponse}, nil
+}
+
+// smtpStartTLSGetter negotiates STARTTLS per RFC 3207: EHLO, then STARTTLS,
+// then the TLS handshake.
+type smtpStartTLSGetter struct{}
+
+func (smtpStartTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	conn, err := dialPlain(ctx, dialer, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := readSMTPReply(r); err != nil { // server greeting
+		conn.Close()
+		return nil, err
+	}
+
+	if err := sendLine(conn, "EHLO "+appName); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := readSMTPReply(r); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := sendLine(conn, "STARTTLS"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := readSMTPReply(r); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return upgradeToTLS(conn, host)
+}
+
+// readSMTPReply reads a (possibly multi-line) SMTP reply and returns the
+// final line, failing if the reply code isn't 2xx/3xx.
+func readSMTPReply(r *bufio.Reader) (string, error) {
+	var last string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		last = strings.TrimRight(line, "\r\n")
+		if len(last) >= 4 && last[3] == ' ' {
+			break
+		}
+	}
+	if len(last) < 1 || (last[0] != '2' && last[0] != '3') {
+		return "", fmt.Errorf("unexpected SMTP reply: %s", last)
+	}
+	return last, nil
+}
+
+// imapStartTLSGetter negotiates STARTTLS per RFC 3501 using a single fixed
+// tag.
+type imapStartTLSGetter struct{}
+
+func (imapStartTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	conn, err := dialPlain(ctx, dialer, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil { // server greeting
+		conn.Close()
+		return nil, err
+	}
+
+	if err := sendLine(conn, "a1 STARTTLS"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(reply, "a1 OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP reply: %s", strings.TrimSpace(reply))
+	}
+
+	return upgradeToTLS(conn, host)
+}
+
+// pop3StartTLSGetter negotiates STLS per RFC 2595.
+type pop3StartTLSGetter struct{}
+
+func (pop3StartTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	conn, err := dialPlain(ctx, dialer, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil { // server greeting
+		conn.Close()
+		return nil, err
+	}
+
+	if err := sendLine(conn, "STLS"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(reply, "+OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected POP3 reply: %s", strings.TrimSpace(reply))
+	}
+
+	return upgradeToTLS(conn, host)
+}
+
+// ftpStartTLSGetter negotiates explicit FTPS via AUTH TLS per RFC 4217.
+type ftpStartTLSGetter struct{}
+
+func (ftpStartTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	conn, err := dialPlain(ctx, dialer, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil { // server greeting
+		conn.Close()
+		return nil, err
+	}
+
+	if err := sendLine(conn, "AUTH TLS"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(reply, "234") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected FTP reply: %s", strings.TrimSpace(reply))
+	}
+
+	return upgradeToTLS(conn, host)
+}
+
+// ldapStartTLSGetter issues the StartTLS extended operation (OID
+// 1.3.6.1.4.1.1466.20037) defined in RFC 4511. The extended request/response
+// envelope is hand-rolled BER rather than pulled in from a full LDAP client
+// library, since all expirybot needs is the handshake, not a session.
+type ldapStartTLSGetter struct{}
+
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+func (ldapStartTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	conn, err := dialPlain(ctx, dialer, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(ldapExtendedRequest(1, ldapStartTLSOID)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Read and discard the ExtendedResponse envelope; a real client would
+	// parse the resultCode here, but any response at all indicates the
+	// server is ready to continue in the clear or has upgraded already.
+	buf := make([]byte, 4096)
+	if _, err := conn.Read(buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return upgradeToTLS(conn, host)
+}
+
+// ldapExtendedRequest builds a minimal BER-encoded LDAPMessage wrapping an
+// ExtendedRequest for the given OID.
+func ldapExtendedRequest(messageID int, oid string) []byte {
+	requestName := berTag(0x80, []byte(oid)) // [0] requestName
+	extendedReq := berTag(0x77, requestName) // [APPLICATION 23] ExtendedRequest
+	msgID := berTag(0x02, []byte{byte(messageID)})
+	message := berTag(0x30, append(msgID, extendedReq...))
+	return message
+}
+
+// berTag wraps value in a BER tag/length/value triple. Lengths are assumed
+// to fit in a single byte, which holds for the small requests expirybot
+// sends.
+func berTag(tag byte, value []byte) []byte {
+	return append([]byte{tag, byte(len(value))}, value...)
+}
+
+// postgresStartTLSGetter issues Postgres's SSLRequest as described in the
+// frontend/backend protocol docs: a fixed-size message is sent before any
+// startup packet, and the server replies with a single 'S' (proceed with
+// TLS) or 'N' (SSL not supported) byte.
+type postgresStartTLSGetter struct{}
+
+func (postgresStartTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	conn, err := dialPlain(ctx, dialer, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	// SSLRequest: length(4) + request code 80877103, big-endian.
+	sslRequest := []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+	if _, err := conn.Write(sslRequest); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply := make([]byte, 1)
+	if _, err := conn.Read(reply); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if reply[0] != 'S' {
+		conn.Close()
+		return nil, fmt.Errorf("postgres server does not support SSL")
+	}
+
+	return upgradeToTLS(conn, host)
+}
+
+// mysqlStartTLSGetter performs the first leg of the MySQL client/server
+// handshake far enough to set the CLIENT_SSL capability flag and send an
+// SSLRequest packet, then hands the connection to the TLS layer as
+// described in the MySQL internals manual's "SSL Handshake" section.
+type mysqlStartTLSGetter struct{}
+
+const (
+	mysqlClientSSL        = 0x00000800
+	mysqlClientProtocol41 = 0x00000200
+)
+
+func (mysqlStartTLSGetter) GetCertificates(ctx context.Context, dialer *net.Dialer, host string, port int) (*CertFetchResult, error) {
+	conn, err := dialPlain(ctx, dialer, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read and discard the server's initial handshake packet; we don't
+	// need its contents to request SSL, only its sequence number (0).
+	header := make([]byte, 4)
+	if _, err := readFull(conn, header); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if _, err := readFull(conn, make([]byte, length)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// SSLRequest packet: capability flags, max packet size, charset, 23
+	// reserved bytes - everything up to (but not including) the username.
+	body := make([]byte, 32)
+	flags := uint32(mysqlClientSSL | mysqlClientProtocol41)
+	body[0] = byte(flags)
+	body[1] = byte(flags >> 8)
+	body[2] = byte(flags >> 16)
+	body[3] = byte(flags >> 24)
+	// bytes [4:8) max packet size, left zero; byte[8] charset, left zero;
+	// bytes [9:32) reserved, left zero.
+
+	packet := append([]byte{byte(len(body)), byte(len(body) >> 8), byte(len(body) >> 16), 1}, body...)
+	if _, err := conn.Write(packet); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return upgradeToTLS(conn, host)
+}
+
+// readFull reads exactly len(buf) bytes from conn.
+func readFull(conn net.Conn, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := conn.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// sendLine writes s followed by a CRLF line ending, as required by the
+// line-oriented protocols above.
+func sendLine(conn net.Conn, s string) error {
+	_, err := conn.Write([]byte(s + "\r\n"))
+	return err
+}
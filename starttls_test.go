@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// A server that accepts the TCP connection but never sends its
+// greeting must not hang a STARTTLS getter forever - it should time out
+// once ctx's deadline passes.
+func TestSMTPStartTLSGetterRespectsContextDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Accept the connection and then never write anything, simulating
+		// a server that hangs mid-negotiation.
+		<-context.Background().Done()
+	}()
+
+	host, portStr, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to split listener address: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("failed to parse port %q: %v", portStr, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	dialer := &net.Dialer{Timeout: 200 * time.Millisecond}
+
+	done := make(chan struct{})
+	go func() {
+		smtpStartTLSGetter{}.GetCertificates(ctx, dialer, host, port)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetCertificates did not return within the context deadline")
+	}
+}
+
+func TestBerTag(t *testing.T) {
+	got := berTag(0x02, []byte{0x01})
+	want := []byte{0x02, 0x01, 0x01}
+	if !bytes.Equal(got, want) {
+		t.Errorf("berTag(0x02, {0x01}) = %x, want %x", got, want)
+	}
+}
+
+// ldapExtendedRequest must produce the exact BER-encoded LDAPMessage a
+// directory server expects for the StartTLS extended operation - there's no
+// ASN.1 library backing this, so a byte-for-byte fixture is the only thing
+// that would catch a regression here.
+func TestLdapExtendedRequest(t *testing.T) {
+	got := ldapExtendedRequest(1, ldapStartTLSOID)
+
+	want, err := hex.DecodeString("301d02010177188016312e332e362e312e342e312e313436362e3230303337")
+	if err != nil {
+		t.Fatalf("failed to decode expected fixture: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("ldapExtendedRequest(1, %q) = %x, want %x", ldapStartTLSOID, got, want)
+	}
+}
+
+// mysqlStartTLSGetter must read past the server's initial handshake packet
+// (using its 3-byte little-endian length, not the 4-byte header) before
+// writing an SSLRequest packet with CLIENT_SSL and CLIENT_PROTOCOL_41 set
+// and sequence number 1.
+func TestMysqlStartTLSGetterSendsSSLRequest(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	sslRequestCh := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		serverHandshake := []byte{
+			0x0a,                          // protocol version
+			'8', '.', '0', '.', '0', 0x00, // server version, NUL-terminated
+		}
+		packet := append([]byte{byte(len(serverHandshake)), 0x00, 0x00, 0x00}, serverHandshake...)
+		if _, err := conn.Write(packet); err != nil {
+			return
+		}
+
+		// Read exactly the SSLRequest packet; a ClientHello may follow
+		// immediately behind it once GetCertificates starts the TLS
+		// handshake, so we must not read past it.
+		buf := make([]byte, 36)
+		if _, err := readFull(conn, buf); err != nil {
+			return
+		}
+		sslRequestCh <- buf
+	}()
+
+	host, portStr, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to split listener address: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("failed to parse port %q: %v", portStr, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	dialer := &net.Dialer{Timeout: 2 * time.Second}
+
+	go func() {
+		// GetCertificates will fail once it tries to TLS-upgrade a plain
+		// socket with no real TLS server on the other end; we only care
+		// about the plaintext SSLRequest packet it wrote before that.
+		mysqlStartTLSGetter{}.GetCertificates(ctx, dialer, host, port)
+	}()
+
+	var sslRequest []byte
+	select {
+	case sslRequest = <-sslRequestCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never received the SSLRequest packet")
+	}
+
+	if len(sslRequest) != 36 {
+		t.Fatalf("SSLRequest packet length = %d, want 36 (4-byte header + 32-byte body)", len(sslRequest))
+	}
+
+	length := int(sslRequest[0]) | int(sslRequest[1])<<8 | int(sslRequest[2])<<16
+	if length != 32 {
+		t.Errorf("packet length field = %d, want 32", length)
+	}
+	if sslRequest[3] != 1 {
+		t.Errorf("sequence number = %d, want 1", sslRequest[3])
+	}
+
+	flags := uint32(sslRequest[4]) | uint32(sslRequest[5])<<8 | uint32(sslRequest[6])<<16 | uint32(sslRequest[7])<<24
+	if flags&mysqlClientSSL == 0 {
+		t.Error("CLIENT_SSL flag not set in SSLRequest")
+	}
+	if flags&mysqlClientProtocol41 == 0 {
+		t.Error("CLIENT_PROTOCOL_41 flag not set in SSLRequest")
+	}
+}